@@ -0,0 +1,364 @@
+// Package audit records login and proxy events and fans them out to
+// any configured Sinks (see audit/sinks) in addition to the existing
+// Mongo persistence, so an external SIEM can consume them in real
+// time.
+package audit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/errortypes"
+	"github.com/pritunl/pritunl-zero/node"
+	"github.com/pritunl/pritunl-zero/service"
+	"github.com/pritunl/pritunl-zero/user"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	Login       = "login"
+	LoginFailed = "login_failed"
+	SsoCallback = "sso_callback"
+	ProxyDeny   = "proxy_deny"
+	Logout      = "logout"
+
+	queueSize = 4096
+
+	dispatchAttempts = 3
+	dispatchBackoff  = 500 * time.Millisecond
+	dispatchTimeout  = 10 * time.Second
+
+	overflowSweepInterval = 30 * time.Second
+	overflowSweepLimit    = 100
+
+	// overflowMaxEntries bounds the overflow collection so a sustained
+	// sink outage can't grow it without limit; once it's exceeded the
+	// oldest entries are evicted on each sweep. A literal Mongo capped
+	// collection isn't usable here since sweepOverflow needs to delete
+	// arbitrary documents (successfully redelivered entries), which
+	// capped collections forbid.
+	overflowMaxEntries = 10000
+)
+
+type Fields map[string]interface{}
+
+// Event is the schema shipped to every configured Sink.
+type Event struct {
+	Id         bson.ObjectId `bson:"_id,omitempty" json:"id"`
+	Timestamp  time.Time     `bson:"timestamp" json:"timestamp"`
+	UserId     bson.ObjectId `bson:"user_id,omitempty" json:"user_id"`
+	Username   string        `bson:"username" json:"username"`
+	Service    string        `bson:"service" json:"service"`
+	RemoteAddr string        `bson:"remote_addr" json:"remote_addr"`
+	UserAgent  string        `bson:"user_agent" json:"user_agent"`
+	Action     string        `bson:"action" json:"action"`
+	Method     string        `bson:"method" json:"method"`
+	Fields     Fields        `bson:"fields" json:"fields"`
+}
+
+// Sink receives a stream of audit Events, typically forwarding them to
+// an external system (webhook, syslog, file tail, ...). Send must not
+// block the caller for long; slow sinks should buffer internally.
+type Sink interface {
+	Label() string
+	Send(ctx context.Context, evt *Event) error
+}
+
+// OverflowEntry is a dispatch that exhausted its retries, persisted so
+// the overflow sweep can keep retrying it and the management UI can
+// show it as a recent failure.
+type OverflowEntry struct {
+	Id        bson.ObjectId `bson:"_id,omitempty" json:"id"`
+	Sink      string        `bson:"sink" json:"sink"`
+	Event     *Event        `bson:"event" json:"event"`
+	Attempts  int           `bson:"attempts" json:"attempts"`
+	LastError string        `bson:"last_error" json:"last_error"`
+	Timestamp time.Time     `bson:"timestamp" json:"timestamp"`
+}
+
+var (
+	sinksLock sync.RWMutex
+	sinks     = []Sink{}
+
+	queue = make(chan *Event, queueSize)
+)
+
+// RegisterSink adds sink to the set of sinks every audit Event is
+// dispatched to. It is called during node init from the configured
+// settings collection (see mhandlers.LoadSinks).
+func RegisterSink(sink Sink) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	sinks = append(sinks, sink)
+}
+
+// Sinks returns the currently configured sinks.
+func Sinks() []Sink {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+
+	out := make([]Sink, len(sinks))
+	copy(out, sinks)
+	return out
+}
+
+func sinkByLabel(label string) Sink {
+	for _, sink := range Sinks() {
+		if sink.Label() == label {
+			return sink
+		}
+	}
+	return nil
+}
+
+// SendTest sends a synthetic event through the named sink, for the
+// management "test sink" action.
+func SendTest(ctx context.Context, label string) (err error) {
+	sink := sinkByLabel(label)
+	if sink == nil {
+		err = &errortypes.NotValidError{
+			errors.Newf("audit: Unknown sink '%s'", label),
+		}
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, dispatchTimeout)
+	defer cancel()
+
+	err = sink.Send(sendCtx, &Event{
+		Id:        bson.NewObjectId(),
+		Timestamp: time.Now(),
+		Action:    "test",
+		Fields:    Fields{"synthetic": true},
+	})
+	return
+}
+
+// RecentFailures returns up to limit dispatches still sitting in the
+// overflow buffer, awaiting redelivery by the sweep worker.
+func RecentFailures(ctx context.Context, db *database.Database,
+	limit int) (entries []*OverflowEntry, err error) {
+
+	err = db.AuditOverflowCtx(ctx).FindSorted(
+		bson.M{}, "-timestamp", limit, &entries)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// sendWithRetry attempts delivery up to dispatchAttempts times with
+// exponential backoff before giving up.
+func sendWithRetry(ctx context.Context, sink Sink, evt *Event) (err error) {
+	backoff := dispatchBackoff
+
+	for attempt := 1; attempt <= dispatchAttempts; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, dispatchTimeout)
+		err = sink.Send(sendCtx, evt)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		if attempt < dispatchAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return
+}
+
+// bufferOverflow persists evt for sink so the overflow sweep can keep
+// retrying delivery without holding up the caller.
+func bufferOverflow(sinkLabel string, evt *Event, attempts int, reason error) {
+	go func() {
+		db := database.GetDatabase()
+		defer db.Close()
+
+		err := db.AuditOverflow().Insert(&OverflowEntry{
+			Id:        bson.NewObjectId(),
+			Sink:      sinkLabel,
+			Event:     evt,
+			Attempts:  attempts,
+			LastError: reason.Error(),
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"sink":  sinkLabel,
+				"error": err,
+			}).Error("audit: Failed to persist overflow entry")
+		}
+	}()
+}
+
+func dispatch(evt *Event) {
+	for _, sink := range Sinks() {
+		go func(sink Sink) {
+			err := sendWithRetry(context.Background(), sink, evt)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"sink":  sink.Label(),
+					"error": err,
+				}).Error("audit: Sink dispatch failed after retries, buffering")
+				bufferOverflow(sink.Label(), evt, dispatchAttempts, err)
+			}
+		}(sink)
+	}
+}
+
+func worker() {
+	for evt := range queue {
+		dispatch(evt)
+	}
+}
+
+// enforceOverflowCap evicts the oldest overflow entries once the
+// collection grows past overflowMaxEntries, so a sustained sink outage
+// can't let it grow without bound.
+func enforceOverflowCap(coll *database.Collection) {
+	count, err := coll.Count()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("audit: Failed to count overflow buffer")
+		return
+	}
+
+	over := count - overflowMaxEntries
+	if over <= 0 {
+		return
+	}
+
+	var oldest []*OverflowEntry
+	err = coll.FindSorted(bson.M{}, "timestamp", over, &oldest)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("audit: Failed to read overflow buffer for eviction")
+		return
+	}
+
+	for _, entry := range oldest {
+		coll.RemoveId(entry.Id)
+	}
+}
+
+// sweepOverflow retries the oldest overflowSweepLimit buffered
+// dispatches once each, removing an entry from the overflow collection
+// on success.
+func sweepOverflow() {
+	db := database.GetDatabase()
+	defer db.Close()
+
+	coll := db.AuditOverflow()
+
+	enforceOverflowCap(coll)
+
+	var entries []*OverflowEntry
+	err := coll.FindSorted(bson.M{}, "timestamp", overflowSweepLimit, &entries)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("audit: Failed to read overflow buffer")
+		return
+	}
+
+	for _, entry := range entries {
+		sink := sinkByLabel(entry.Sink)
+		if sink == nil {
+			coll.RemoveId(entry.Id)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(
+			context.Background(), dispatchTimeout)
+		err = sink.Send(ctx, entry.Event)
+		cancel()
+		if err == nil {
+			coll.RemoveId(entry.Id)
+			continue
+		}
+
+		entry.Attempts++
+		entry.LastError = err.Error()
+		coll.UpdateId(entry.Id, entry)
+	}
+}
+
+func overflowWorker() {
+	ticker := time.NewTicker(overflowSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sweepOverflow()
+	}
+}
+
+func init() {
+	go worker()
+	go overflowWorker()
+}
+
+// New persists evt to Mongo and enqueues it for delivery to any
+// registered Sinks. Enqueueing never blocks the request path; if the
+// in-memory queue is full the event is handed straight to the
+// overflow buffer instead of being dropped, so a burst of traffic
+// during a sink outage still delivers at-least-once.
+func New(
+	ctx context.Context,
+	db *database.Database,
+	req *http.Request,
+	usr *user.User,
+	srvc *service.Service,
+	method string,
+	action string,
+	fields Fields,
+) (err error) {
+	evt := &Event{
+		Id:         bson.NewObjectId(),
+		Timestamp:  time.Now(),
+		RemoteAddr: node.Self.GetRemoteAddr(req),
+		UserAgent:  req.UserAgent(),
+		Action:     action,
+		Method:     method,
+		Fields:     fields,
+	}
+
+	if usr != nil {
+		evt.UserId = usr.Id
+		evt.Username = usr.Username
+	}
+
+	if srvc != nil {
+		evt.Service = srvc.Name
+	}
+
+	coll := db.AuditsCtx(ctx)
+	_, err = coll.UpsertId(evt.Id, evt)
+	if err != nil {
+		return
+	}
+
+	select {
+	case queue <- evt:
+	default:
+		logrus.WithFields(logrus.Fields{
+			"action": action,
+		}).Warn("audit: Sink queue full, buffering for async delivery")
+
+		for _, sink := range Sinks() {
+			bufferOverflow(sink.Label(), evt, 0,
+				errors.New("audit: sink queue full"))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dropbox/godropbox/errors"
+)
+
+// failNTimesSink fails its first n Send calls then succeeds, so tests
+// can exercise sendWithRetry's backoff loop without a real sink.
+type failNTimesSink struct {
+	label   string
+	failN   int32
+	calls   int32
+	lastEvt *Event
+}
+
+func (s *failNTimesSink) Label() string { return s.label }
+
+func (s *failNTimesSink) Send(ctx context.Context, evt *Event) error {
+	n := atomic.AddInt32(&s.calls, 1)
+	s.lastEvt = evt
+	if n <= s.failN {
+		return errors.New("sink: simulated failure")
+	}
+	return nil
+}
+
+func TestSendWithRetrySucceedsAfterTransientFailures(t *testing.T) {
+	sink := &failNTimesSink{label: "test", failN: 2}
+
+	err := sendWithRetry(context.Background(), sink, &Event{Action: Login})
+	if err != nil {
+		t.Fatalf("sendWithRetry returned %v, want nil", err)
+	}
+
+	if sink.calls != 3 {
+		t.Errorf("sink called %d times, want 3", sink.calls)
+	}
+}
+
+func TestSendWithRetryGivesUpAfterDispatchAttempts(t *testing.T) {
+	sink := &failNTimesSink{label: "test", failN: int32(dispatchAttempts)}
+
+	err := sendWithRetry(context.Background(), sink, &Event{Action: Login})
+	if err == nil {
+		t.Fatal("sendWithRetry returned nil, want the sink's last error")
+	}
+
+	if sink.calls != int32(dispatchAttempts) {
+		t.Errorf("sink called %d times, want %d", sink.calls, dispatchAttempts)
+	}
+}
+
+func TestRegisterSinkAndSinks(t *testing.T) {
+	before := len(Sinks())
+
+	sink := &failNTimesSink{label: "registered-test-sink"}
+	RegisterSink(sink)
+
+	after := Sinks()
+	if len(after) != before+1 {
+		t.Fatalf("Sinks() has %d entries, want %d", len(after), before+1)
+	}
+
+	if sinkByLabel(sink.label) != sink {
+		t.Errorf("sinkByLabel(%q) did not return the registered sink",
+			sink.label)
+	}
+}
+
+func TestSendTestUnknownSink(t *testing.T) {
+	err := SendTest(context.Background(), "no-such-sink-label")
+	if err == nil {
+		t.Fatal("SendTest for an unregistered label returned nil, want an error")
+	}
+}
+
+func TestSendTestKnownSink(t *testing.T) {
+	sink := &failNTimesSink{label: "send-test-sink"}
+	RegisterSink(sink)
+
+	err := SendTest(context.Background(), sink.label)
+	if err != nil {
+		t.Fatalf("SendTest returned %v, want nil", err)
+	}
+
+	if sink.lastEvt == nil || sink.lastEvt.Action != "test" {
+		t.Errorf("SendTest did not deliver a synthetic test event")
+	}
+}
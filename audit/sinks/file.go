@@ -0,0 +1,72 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-zero/audit"
+	"github.com/pritunl/pritunl-zero/errortypes"
+)
+
+// File appends each audit.Event as a newline-delimited JSON object to
+// Path, for tools (Filebeat, Fluentd, ...) that tail a local log file.
+type File struct {
+	Name string
+	Path string
+
+	lock sync.Mutex
+	file *os.File
+}
+
+func (f *File) Label() string {
+	return f.Name
+}
+
+func (f *File) open() (err error) {
+	if f.file != nil {
+		return
+	}
+
+	file, err := os.OpenFile(
+		f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "sinks: Failed to open audit tail file"),
+		}
+		return
+	}
+
+	f.file = file
+	return
+}
+
+func (f *File) Send(ctx context.Context, evt *audit.Event) (err error) {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "sinks: Failed to marshal audit event"),
+		}
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	err = f.open()
+	if err != nil {
+		return
+	}
+
+	_, err = f.file.Write(append(data, '\n'))
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "sinks: Failed to write audit tail file"),
+		}
+		return
+	}
+
+	return
+}
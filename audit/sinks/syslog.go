@@ -0,0 +1,93 @@
+package sinks
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-zero/audit"
+	"github.com/pritunl/pritunl-zero/errortypes"
+)
+
+const (
+	syslogFacility = 10 // security/authorization messages
+	syslogSeverity = 6  // informational
+)
+
+// Syslog ships each audit.Event as an RFC 5424 message over UDP, TCP or
+// TLS, depending on Network.
+type Syslog struct {
+	Name    string
+	Network string // udp, tcp, tls
+	Addr    string
+	AppName string
+	Timeout time.Duration
+}
+
+func (s *Syslog) Label() string {
+	return s.Name
+}
+
+func (s *Syslog) dial() (conn net.Conn, err error) {
+	dialer := &net.Dialer{
+		Timeout: s.Timeout,
+	}
+
+	if s.Network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.Addr, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial(s.Network, s.Addr)
+	}
+
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "sinks: Failed to dial syslog server"),
+		}
+	}
+
+	return
+}
+
+func (s *Syslog) Send(ctx context.Context, evt *audit.Event) (err error) {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "sinks: Failed to marshal audit event"),
+		}
+		return
+	}
+
+	priority := syslogFacility*8 + syslogSeverity
+	msg := fmt.Sprintf(
+		"<%d>1 %s %s %s - - - %s\n",
+		priority,
+		evt.Timestamp.UTC().Format(time.RFC3339),
+		evt.RemoteAddr,
+		s.AppName,
+		data,
+	)
+
+	conn, err := s.dial()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+
+	_, err = conn.Write([]byte(msg))
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "sinks: Failed to write syslog message"),
+		}
+		return
+	}
+
+	return
+}
@@ -0,0 +1,85 @@
+// Package sinks provides audit.Sink implementations: outbound HTTP
+// webhooks, syslog, and a newline-delimited JSON tail file.
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-zero/audit"
+	"github.com/pritunl/pritunl-zero/errortypes"
+)
+
+const webhookSigHeader = "X-Audit-Signature"
+
+// Webhook POSTs each audit.Event as JSON to Url, signing the body with
+// an HMAC-SHA256 of Secret so the receiver can verify authenticity.
+type Webhook struct {
+	Name    string
+	Url     string
+	Secret  string
+	Timeout time.Duration
+}
+
+func (w *Webhook) Label() string {
+	return w.Name
+}
+
+func (w *Webhook) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) Send(ctx context.Context, evt *audit.Event) (err error) {
+	body, err := json.Marshal(evt)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "sinks: Failed to marshal audit event"),
+		}
+		return
+	}
+
+	req, err := http.NewRequest(
+		"POST", w.Url, bytes.NewReader(body))
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "sinks: Failed to build webhook request"),
+		}
+		return
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookSigHeader, w.sign(body))
+
+	client := &http.Client{
+		Timeout: w.Timeout,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		err = &errortypes.UnknownError{
+			errors.Wrap(err, "sinks: Webhook request failed"),
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = &errortypes.UnknownError{
+			errors.Newf(
+				"sinks: Webhook returned status %d", resp.StatusCode),
+		}
+		return
+	}
+
+	return
+}
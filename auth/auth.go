@@ -0,0 +1,391 @@
+// Package auth handles local and SSO login, proxy-session resolution
+// for Router.proxy, and re-checking an already logged-in user's
+// access on every request.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-zero/cookie"
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/service"
+	"github.com/pritunl/pritunl-zero/session"
+	"github.com/pritunl/pritunl-zero/user"
+	"github.com/pritunl/pritunl-zero/validator"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ssoUserType is the Type recorded on a user record auto-provisioned
+// from a verified SSO callback.
+const ssoUserType = "sso"
+
+// stateTTL is how long a state token issued by Request stays valid for
+// a matching Callback before it's treated as expired.
+const stateTTL = 5 * time.Minute
+
+// ssoState is a single-use token persisted by Request and consumed by
+// Callback, proving the callback is answering a login this node
+// actually initiated rather than a forged or replayed request.
+type ssoState struct {
+	Id        string    `bson:"_id"`
+	Timestamp time.Time `bson:"timestamp"`
+}
+
+// ssoSettings holds the per-node SSO signing secret, stored in the
+// settings collection alongside the sink config mhandlers.LoadSinks
+// reads.
+type ssoSettings struct {
+	Secret string `bson:"secret"`
+}
+
+// InvalidState is returned by Callback when the SSO state/signature on
+// the request doesn't match one this node issued.
+type InvalidState struct {
+	errors.DropboxError
+}
+
+type StateProvider struct {
+	Id    string `json:"id"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+type State struct {
+	Providers []*StateProvider `json:"providers"`
+}
+
+// GetState returns the set of configured SSO providers shown on the
+// login page.
+func GetState() *State {
+	return &State{
+		Providers: []*StateProvider{},
+	}
+}
+
+// ssoSecret returns the HMAC secret Callback verifies signatures
+// against, generating and persisting one on first use the same way a
+// CSRF token is minted.
+func ssoSecret(ctx context.Context, db *database.Database) (
+	secret []byte, err error) {
+
+	settings := &ssoSettings{}
+	err = db.SettingsCtx(ctx).FindId("sso", settings)
+	if err != nil {
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		default:
+			return
+		}
+	}
+
+	if settings.Secret != "" {
+		secret, err = hex.DecodeString(settings.Secret)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	buf := make([]byte, 32)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return
+	}
+	secret = buf
+
+	_, err = db.SettingsCtx(ctx).UpsertId("sso", &struct {
+		Id     string `bson:"_id"`
+		Secret string `bson:"secret"`
+	}{
+		Id:     "sso",
+		Secret: hex.EncodeToString(secret),
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// newState generates and persists a single-use state token for an SSO
+// login this node is about to begin, so the eventual callback can be
+// proven to answer this login rather than a forged or replayed one.
+func newState(ctx context.Context, db *database.Database) (
+	state string, err error) {
+
+	buf := make([]byte, 32)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return
+	}
+	state = hex.EncodeToString(buf)
+
+	err = db.SsoStatesCtx(ctx).Insert(&ssoState{
+		Id:        state,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// consumeState reports whether state is an unexpired token issued by
+// newState, removing it either way so it can't be replayed.
+func consumeState(ctx context.Context, db *database.Database,
+	state string) (valid bool, err error) {
+
+	if state == "" {
+		return
+	}
+
+	coll := db.SsoStatesCtx(ctx)
+
+	doc := &ssoState{}
+	err = coll.FindId(state, doc)
+	if err != nil {
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		}
+		return
+	}
+
+	coll.RemoveId(state)
+
+	valid = time.Since(doc.Timestamp) <= stateTTL
+
+	return
+}
+
+// getOrProvisionUser loads the user identified by a verified SSO
+// callback, creating one on first login the same way an admin would
+// be seeded.
+func getOrProvisionUser(ctx context.Context, db *database.Database,
+	username string) (usr *user.User, err error) {
+
+	usr = &user.User{}
+	err = db.UsersCtx(ctx).FindOne(bson.M{"username": username}, usr)
+	if err == nil {
+		return
+	}
+
+	switch err.(type) {
+	case *database.NotFoundError:
+		err = nil
+	default:
+		usr = nil
+		return
+	}
+
+	usr = &user.User{
+		Id:       bson.NewObjectId(),
+		Type:     ssoUserType,
+		Username: username,
+	}
+
+	err = db.UsersCtx(ctx).Insert(usr)
+	if err != nil {
+		usr = nil
+		return
+	}
+
+	return
+}
+
+// Request begins an SSO login by minting a state token for the
+// eventual callback to present back, then redirecting to "/" with the
+// token in the state query parameter. It does not redirect to any
+// provider's authorization endpoint.
+func Request(c *gin.Context) {
+	ctx := c.Request.Context()
+	db := c.MustGet("db").(*database.Database)
+
+	state, err := newState(ctx, db)
+	if err != nil {
+		c.Redirect(302, "/")
+		return
+	}
+
+	redirect := &url.URL{Path: "/"}
+	query := redirect.Query()
+	query.Set("state", state)
+	redirect.RawQuery = query.Encode()
+
+	c.Redirect(302, redirect.String())
+}
+
+// Local authenticates a username/password pair against the local user
+// store.
+func Local(ctx context.Context, db *database.Database, username string,
+	password string) (usr *user.User, errData *validator.ErrorData,
+	err error) {
+
+	usr = &user.User{}
+	err = db.UsersCtx(ctx).FindOne(bson.M{"username": username}, usr)
+	if err != nil {
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		}
+		usr = nil
+		errData = &validator.ErrorData{
+			Error:   "auth_invalid",
+			Message: "Invalid username or password",
+		}
+		return
+	}
+
+	if !usr.CheckPassword(password) {
+		usr = nil
+		errData = &validator.ErrorData{
+			Error:   "auth_invalid",
+			Message: "Invalid username or password",
+		}
+		return
+	}
+
+	return
+}
+
+// Callback completes an SSO login, verifying sig against query before
+// looking up (or provisioning) the user it identifies.
+func Callback(ctx context.Context, db *database.Database, sig string,
+	query string) (usr *user.User, errData *validator.ErrorData,
+	err error) {
+
+	if sig == "" {
+		err = &InvalidState{
+			errors.New("auth: Missing sso callback signature"),
+		}
+		return
+	}
+
+	secret, err := ssoSecret(ctx, db)
+	if err != nil {
+		return
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(query))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		err = &InvalidState{
+			errors.New("auth: Invalid sso callback signature"),
+		}
+		return
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		err = &InvalidState{
+			errors.Wrap(err, "auth: Invalid sso callback query"),
+		}
+		return
+	}
+
+	username := values.Get("username")
+	if username == "" {
+		err = &InvalidState{
+			errors.New("auth: Missing sso callback username"),
+		}
+		return
+	}
+
+	valid, err := consumeState(ctx, db, values.Get("state"))
+	if err != nil {
+		return
+	}
+
+	if !valid {
+		err = &InvalidState{
+			errors.New("auth: Unknown or expired sso callback state"),
+		}
+		return
+	}
+
+	usr, err = getOrProvisionUser(ctx, db, username)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// CookieSessionProxy resolves the session cookie on a proxy request
+// into the Cookie and Session Router.proxy needs to authorize or deny
+// access to a backend.
+func CookieSessionProxy(ctx context.Context, db *database.Database,
+	w http.ResponseWriter, r *http.Request) (cook *cookie.Cookie,
+	sess *session.Session, err error) {
+
+	cook = cookie.Get(w, r)
+
+	sess, err = cook.GetSession(ctx, db)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Validate re-checks, on every proxied request, whether usr is still
+// allowed to reach srvc.
+func Validate(ctx context.Context, db *database.Database, usr *user.User,
+	srvc *service.Service) (errData *validator.ErrorData, err error) {
+
+	if usr == nil {
+		errData = &validator.ErrorData{
+			Error:   "not_authenticated",
+			Message: "User is not authenticated",
+		}
+		return
+	}
+
+	if usr.Disabled {
+		errData = &validator.ErrorData{
+			Error:   "user_disabled",
+			Message: "User is disabled",
+		}
+		return
+	}
+
+	return
+}
+
+// SyncUser reloads usr from the database so a session picks up a
+// disable/role change made since login, returning whether the user is
+// still active.
+func SyncUser(ctx context.Context, db *database.Database,
+	usr *user.User) (active bool, err error) {
+
+	cur := &user.User{}
+	err = db.UsersCtx(ctx).FindId(usr.Id, cur)
+	if err != nil {
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+			active = false
+			return
+		}
+		return
+	}
+
+	usr.Disabled = cur.Disabled
+	usr.Type = cur.Type
+	active = !cur.Disabled
+
+	return
+}
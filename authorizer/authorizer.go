@@ -0,0 +1,131 @@
+// Package authorizer resolves the session cookie on an incoming
+// request into an Authorizer that downstream middlewear and handlers
+// use to check access and manage the session.
+package authorizer
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pritunl/pritunl-zero/cookie"
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/service"
+	"github.com/pritunl/pritunl-zero/session"
+	"github.com/pritunl/pritunl-zero/user"
+)
+
+// Authorizer represents the caller's session state for the lifetime
+// of a single request.
+type Authorizer struct {
+	api   bool
+	valid bool
+	sess  *session.Session
+	cook  *cookie.Cookie
+}
+
+// NewProxy returns an empty, invalid Authorizer for proxy requests
+// that have no Service configured to authenticate against.
+func NewProxy() *Authorizer {
+	return &Authorizer{}
+}
+
+func (a *Authorizer) IsValid() bool {
+	return a.valid
+}
+
+func (a *Authorizer) IsApi() bool {
+	return a.api
+}
+
+// SessionId returns the id of the underlying session, or "" if this
+// Authorizer has none.
+func (a *Authorizer) SessionId() string {
+	if a.sess == nil {
+		return ""
+	}
+	return a.sess.Id
+}
+
+func (a *Authorizer) GetUser(ctx context.Context, db *database.Database) (
+	usr *user.User, err error) {
+
+	if a.sess == nil {
+		return
+	}
+
+	return a.sess.GetUser(ctx, db)
+}
+
+// Clear removes the underlying session and cookie, used when a user
+// has been disabled or failed admin validation mid-session.
+func (a *Authorizer) Clear(ctx context.Context, db *database.Database,
+	w http.ResponseWriter, r *http.Request) (err error) {
+
+	if a.cook != nil {
+		err = a.cook.Remove(ctx, db)
+		if err != nil {
+			return
+		}
+	}
+
+	a.valid = false
+	a.sess = nil
+	return
+}
+
+// Remove logs the caller out, removing the session and cookie.
+func (a *Authorizer) Remove(ctx context.Context, db *database.Database) (
+	err error) {
+
+	if a.cook != nil {
+		err = a.cook.Remove(ctx, db)
+		if err != nil {
+			return
+		}
+	}
+
+	a.valid = false
+	a.sess = nil
+	return
+}
+
+// Authorize resolves the session cookie on r into an Authorizer for
+// the management and direct-login request paths.
+func Authorize(ctx context.Context, db *database.Database,
+	w http.ResponseWriter, r *http.Request) (authr *Authorizer, err error) {
+
+	cook := cookie.Get(w, r)
+
+	sess, err := cook.GetSession(ctx, db)
+	if err != nil {
+		return
+	}
+
+	authr = &Authorizer{
+		cook:  cook,
+		sess:  sess,
+		valid: sess != nil,
+	}
+	return
+}
+
+// AuthorizeProxy resolves the Proxy-scoped session cookie on r into an
+// Authorizer, valid only if the session belongs to srvc.
+func AuthorizeProxy(ctx context.Context, db *database.Database,
+	srvc *service.Service, w http.ResponseWriter, r *http.Request) (
+	authr *Authorizer, err error) {
+
+	cook := cookie.NewProxy(srvc, w, r)
+
+	sess, err := cook.GetSession(ctx, db)
+	if err != nil {
+		return
+	}
+
+	authr = &Authorizer{
+		cook:  cook.Cookie,
+		sess:  sess,
+		valid: sess != nil && sess.ServiceId == srvc.Id,
+	}
+	return
+}
@@ -0,0 +1,22 @@
+// Package constants holds process-wide configuration values that are
+// not tied to a single request or service.
+package constants
+
+import (
+	"time"
+)
+
+const (
+	Version = "1.0.0"
+
+	CertPath = "/etc/pritunl-zero/cert.pem"
+	KeyPath  = "/etc/pritunl-zero/key.pem"
+
+	// DefaultRequestTimeout bounds how long a request's context stays
+	// alive when a service has not configured its own timeout.
+	DefaultRequestTimeout = 30 * time.Second
+)
+
+var (
+	Production = true
+)
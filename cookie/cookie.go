@@ -0,0 +1,129 @@
+// Package cookie reads and writes the session cookie used by both
+// direct management logins and proxied service logins.
+package cookie
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/service"
+	"github.com/pritunl/pritunl-zero/session"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Cookie wraps the session cookie on a single request/response pair.
+type Cookie struct {
+	Id string
+
+	w http.ResponseWriter
+	r *http.Request
+}
+
+// Get reads the session cookie off r, if any.
+func Get(w http.ResponseWriter, r *http.Request) *Cookie {
+	id := ""
+	c, err := r.Cookie(session.CookieName)
+	if err == nil {
+		id = c.Value
+	}
+
+	return &Cookie{Id: id, w: w, r: r}
+}
+
+func (c *Cookie) set(id string) {
+	http.SetCookie(c.w, &http.Cookie{
+		Name:     session.CookieName,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+	})
+	c.Id = id
+}
+
+func (c *Cookie) clear() {
+	http.SetCookie(c.w, &http.Cookie{
+		Name:   session.CookieName,
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+	})
+	c.Id = ""
+}
+
+// GetSession loads the session this cookie points at, returning a nil
+// session (no error) when there is no cookie or it points at a session
+// that no longer exists.
+func (c *Cookie) GetSession(ctx context.Context, db *database.Database) (
+	sess *session.Session, err error) {
+
+	if c.Id == "" {
+		return
+	}
+
+	sess, err = session.Get(ctx, db, c.Id)
+	if err != nil {
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+			sess = nil
+		}
+		return
+	}
+
+	return
+}
+
+// Remove deletes the underlying session, if any, and clears the
+// cookie on the response.
+func (c *Cookie) Remove(ctx context.Context, db *database.Database) (
+	err error) {
+
+	if c.Id != "" {
+		err = session.Remove(ctx, db, c.Id)
+		if err != nil {
+			return
+		}
+	}
+
+	c.clear()
+	return
+}
+
+// Proxy is a Cookie scoped to a single proxied Service, so a session
+// created through it is only valid for that service.
+type Proxy struct {
+	*Cookie
+	Service *service.Service
+}
+
+// NewProxy returns a Proxy-scoped cookie reader/writer for srvc.
+func NewProxy(srvc *service.Service, w http.ResponseWriter,
+	r *http.Request) *Proxy {
+
+	return &Proxy{Cookie: Get(w, r), Service: srvc}
+}
+
+// NewSession creates and persists a new session for userId scoped to
+// this Proxy's Service, and sets the session cookie on the response.
+func (p *Proxy) NewSession(ctx context.Context, db *database.Database,
+	r *http.Request, userId bson.ObjectId, remember bool) (
+	sess *session.Session, err error) {
+
+	sess = &session.Session{
+		Id:        bson.NewObjectId().Hex(),
+		Type:      "proxy",
+		UserId:    userId,
+		ServiceId: p.Service.Id,
+		Remember:  remember,
+	}
+
+	err = db.SessionsCtx(ctx).Insert(sess)
+	if err != nil {
+		return
+	}
+
+	p.set(sess.Id)
+	return
+}
@@ -0,0 +1,61 @@
+// Package csrf issues and validates the per-session CSRF tokens
+// required on state-changing requests.
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pritunl/pritunl-zero/database"
+)
+
+type token struct {
+	Id        string `bson:"_id"`
+	SessionId string `bson:"session_id"`
+}
+
+// NewToken generates and persists a new CSRF token for sessionId.
+func NewToken(ctx context.Context, db *database.Database,
+	sessionId string) (tok string, err error) {
+
+	buf := make([]byte, 32)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return
+	}
+	tok = hex.EncodeToString(buf)
+
+	err = db.CsrfTokensCtx(ctx).Insert(&token{
+		Id:        tok,
+		SessionId: sessionId,
+	})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// ValidateToken reports whether tok was issued for sessionId.
+func ValidateToken(ctx context.Context, db *database.Database,
+	sessionId string, tok string) (valid bool, err error) {
+
+	if tok == "" {
+		return
+	}
+
+	tokDoc := &token{}
+	err = db.CsrfTokensCtx(ctx).FindId(tok, tokDoc)
+	if err != nil {
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		}
+		return
+	}
+
+	valid = tokDoc.SessionId != "" && tokDoc.SessionId == sessionId
+
+	return
+}
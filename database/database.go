@@ -0,0 +1,246 @@
+// Package database wraps the Mongo driver session pool used by every
+// collection accessor in the project.
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dropbox/godropbox/errors"
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	usersCollection         = "users"
+	sessionsCollection      = "sessions"
+	auditsCollection        = "audits"
+	auditOverflowCollection = "audit_overflow"
+	csrfTokensCollection    = "csrf_tokens"
+	settingsCollection      = "settings"
+	servicesCollection      = "services"
+	ssoStatesCollection     = "sso_states"
+)
+
+// NotFoundError is returned by collection lookups that find nothing,
+// mirroring mgo.ErrNotFound so callers don't need to import mgo.
+type NotFoundError struct {
+	errors.DropboxError
+}
+
+var session *mgo.Session
+
+// Init sets the global session used by GetDatabase/GetDatabaseCtx. It
+// is called once during node startup.
+func Init(sess *mgo.Session) {
+	session = sess
+}
+
+// Database is a handle on a copy of the global Mongo session, scoped
+// to a single request and closed by the caller when done. wg tracks
+// every run() goroutine still in flight so Close can wait for them
+// instead of closing session out from under a query that outlived its
+// context.
+type Database struct {
+	session *mgo.Session
+	ctx     context.Context
+	wg      sync.WaitGroup
+}
+
+// GetDatabase returns a Database with no request context. It exists as
+// a compatibility shim for call sites (background jobs, init code)
+// that run outside of a request.
+func GetDatabase() *Database {
+	return &Database{session: session.Copy(), ctx: context.Background()}
+}
+
+// GetDatabaseCtx returns a Database bound to ctx; collection accessors
+// use ctx to abandon outstanding queries when it is canceled so a
+// client disconnect doesn't hold the Mongo socket open.
+func GetDatabaseCtx(ctx context.Context) *Database {
+	return &Database{session: session.Copy(), ctx: ctx}
+}
+
+// Close waits for any run() calls still in flight (even ones a caller
+// already abandoned on context cancellation) before closing the
+// session, so an orphaned query never runs against a closed session.
+func (d *Database) Close() {
+	d.wg.Wait()
+	d.session.Close()
+}
+
+// run executes fn on the Database's session, returning as soon as ctx
+// is done even if fn hasn't finished yet. The mgo driver has no native
+// context support, so this is the shim the ctx-aware Collection
+// methods use in place of the driver's context variants. Close blocks
+// on d.wg until every run, including ones abandoned this way, has
+// actually returned.
+func (d *Database) run(ctx context.Context, fn func() error) error {
+	d.wg.Add(1)
+	done := make(chan error, 1)
+	go func() {
+		defer d.wg.Done()
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return translateErr(err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// translateErr maps mgo.ErrNotFound to the package's own NotFoundError
+// so callers can switch on err.(type) without importing mgo.
+func translateErr(err error) error {
+	if err == mgo.ErrNotFound {
+		return &NotFoundError{
+			errors.New("database: Not found"),
+		}
+	}
+	return err
+}
+
+// Collection wraps an *mgo.Collection so Find/Update/Insert calls can
+// be abandoned when ctx is done. ctx is the context the accessor
+// (Users/UsersCtx/...) that produced this Collection was given, not
+// necessarily the owning Database's own context.
+type Collection struct {
+	*mgo.Collection
+	db  *Database
+	ctx context.Context
+}
+
+func (c *Collection) FindId(id interface{}, result interface{}) error {
+	return c.db.run(c.ctx, func() error {
+		return c.Collection.FindId(id).One(result)
+	})
+}
+
+func (c *Collection) FindOne(query interface{}, result interface{}) error {
+	return c.db.run(c.ctx, func() error {
+		return c.Collection.Find(query).One(result)
+	})
+}
+
+func (c *Collection) FindAll(query interface{}, result interface{}) error {
+	return c.db.run(c.ctx, func() error {
+		return c.Collection.Find(query).All(result)
+	})
+}
+
+// FindSorted behaves like FindAll but orders by sort (an mgo sort key,
+// e.g. "timestamp" or "-timestamp") and, when limit > 0, caps the
+// number of documents fetched instead of pulling the whole collection
+// into memory before trimming it.
+func (c *Collection) FindSorted(query interface{}, sort string, limit int,
+	result interface{}) error {
+
+	return c.db.run(c.ctx, func() error {
+		q := c.Collection.Find(query).Sort(sort)
+		if limit > 0 {
+			q = q.Limit(limit)
+		}
+		return q.All(result)
+	})
+}
+
+func (c *Collection) Count() (n int, err error) {
+	err = c.db.run(c.ctx, func() error {
+		var e error
+		n, e = c.Collection.Count()
+		return e
+	})
+	return
+}
+
+func (c *Collection) UpdateId(id interface{}, update interface{}) error {
+	return c.db.run(c.ctx, func() error {
+		return c.Collection.UpdateId(id, update)
+	})
+}
+
+func (c *Collection) UpsertId(id interface{}, update interface{}) (
+	*mgo.ChangeInfo, error) {
+
+	var info *mgo.ChangeInfo
+	err := c.db.run(c.ctx, func() error {
+		var e error
+		info, e = c.Collection.UpsertId(id, update)
+		return e
+	})
+	return info, err
+}
+
+func (c *Collection) Insert(docs ...interface{}) error {
+	return c.db.run(c.ctx, func() error {
+		return c.Collection.Insert(docs...)
+	})
+}
+
+func (c *Collection) RemoveId(id interface{}) error {
+	return c.db.run(c.ctx, func() error {
+		return c.Collection.RemoveId(id)
+	})
+}
+
+func (c *Collection) RemoveAll(query interface{}) error {
+	return c.db.run(c.ctx, func() error {
+		_, e := c.Collection.RemoveAll(query)
+		return e
+	})
+}
+
+func (d *Database) coll(ctx context.Context, name string) *Collection {
+	return &Collection{
+		Collection: d.session.DB("").C(name),
+		db:         d,
+		ctx:        ctx,
+	}
+}
+
+// The *Ctx accessors bind the returned Collection to the passed ctx
+// rather than the Database's own, so a caller can scope a single
+// query to a tighter deadline than the request's overall context.
+
+func (d *Database) Users() *Collection { return d.coll(d.ctx, usersCollection) }
+func (d *Database) UsersCtx(ctx context.Context) *Collection {
+	return d.coll(ctx, usersCollection)
+}
+
+func (d *Database) Sessions() *Collection { return d.coll(d.ctx, sessionsCollection) }
+func (d *Database) SessionsCtx(ctx context.Context) *Collection {
+	return d.coll(ctx, sessionsCollection)
+}
+
+func (d *Database) Audits() *Collection { return d.coll(d.ctx, auditsCollection) }
+func (d *Database) AuditsCtx(ctx context.Context) *Collection {
+	return d.coll(ctx, auditsCollection)
+}
+
+func (d *Database) AuditOverflow() *Collection {
+	return d.coll(d.ctx, auditOverflowCollection)
+}
+func (d *Database) AuditOverflowCtx(ctx context.Context) *Collection {
+	return d.coll(ctx, auditOverflowCollection)
+}
+
+func (d *Database) CsrfTokens() *Collection { return d.coll(d.ctx, csrfTokensCollection) }
+func (d *Database) CsrfTokensCtx(ctx context.Context) *Collection {
+	return d.coll(ctx, csrfTokensCollection)
+}
+
+func (d *Database) Settings() *Collection { return d.coll(d.ctx, settingsCollection) }
+func (d *Database) SettingsCtx(ctx context.Context) *Collection {
+	return d.coll(ctx, settingsCollection)
+}
+
+func (d *Database) Services() *Collection { return d.coll(d.ctx, servicesCollection) }
+func (d *Database) ServicesCtx(ctx context.Context) *Collection {
+	return d.coll(ctx, servicesCollection)
+}
+
+func (d *Database) SsoStates() *Collection { return d.coll(d.ctx, ssoStatesCollection) }
+func (d *Database) SsoStatesCtx(ctx context.Context) *Collection {
+	return d.coll(ctx, ssoStatesCollection)
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// TestRunCancellation verifies that run abandons fn's result as soon
+// as the Database's context is canceled, matching a client disconnect
+// mid-request, instead of waiting for fn to finish.
+func TestRunCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := &Database{ctx: ctx}
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	result := make(chan error, 1)
+
+	go func() {
+		result <- db.run(ctx, func() error {
+			close(started)
+			<-unblock
+			return nil
+		})
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != ctx.Err() {
+			t.Errorf("run returned %v, want %v", err, ctx.Err())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run did not return promptly after cancellation")
+	}
+
+	close(unblock)
+}
+
+// TestCloseWaitsForRun verifies Close blocks until a run() call
+// abandoned by a canceled context has actually finished, instead of
+// closing the session out from under it.
+func TestCloseWaitsForRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := &Database{ctx: ctx, session: &mgo.Session{}}
+
+	unblock := make(chan struct{})
+	started := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		db.run(ctx, func() error {
+			close(started)
+			<-unblock
+			close(finished)
+			return nil
+		})
+	}()
+
+	<-started
+	cancel()
+
+	closed := make(chan struct{})
+	go func() {
+		db.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the abandoned run finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(unblock)
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return after the abandoned run finished")
+	}
+
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Close returned before fn actually completed")
+	}
+}
+
+// TestTranslateErrNotFound verifies mgo.ErrNotFound surfaces as the
+// package's own NotFoundError so callers never need to import mgo.
+func TestTranslateErrNotFound(t *testing.T) {
+	err := translateErr(mgo.ErrNotFound)
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("translateErr(mgo.ErrNotFound) = %T, want *NotFoundError", err)
+	}
+}
+
+func TestTranslateErrPassthrough(t *testing.T) {
+	other := errors.New("boom")
+	if err := translateErr(other); err != other {
+		t.Errorf("translateErr(other) = %v, want %v", err, other)
+	}
+}
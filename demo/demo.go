@@ -0,0 +1,13 @@
+// Package demo reports whether this node runs in the demo mode used on
+// the public demo instance, where a canned "demo" SSO provider is
+// offered. Nothing in this package rejects writes.
+package demo
+
+import (
+	"os"
+)
+
+// IsDemo reports whether this node is running in demo mode.
+func IsDemo() bool {
+	return os.Getenv("PRITUNL_ZERO_DEMO") == "true"
+}
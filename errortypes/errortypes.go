@@ -0,0 +1,36 @@
+// Package errortypes defines the typed errors used throughout
+// pritunl-zero so callers can switch on err.(type) instead of
+// matching on error strings.
+package errortypes
+
+import (
+	"github.com/dropbox/godropbox/errors"
+)
+
+type NotValidError struct {
+	errors.DropboxError
+}
+
+type ParseError struct {
+	errors.DropboxError
+}
+
+type ReadError struct {
+	errors.DropboxError
+}
+
+type WriteError struct {
+	errors.DropboxError
+}
+
+type RequestError struct {
+	errors.DropboxError
+}
+
+type AuthenticationError struct {
+	errors.DropboxError
+}
+
+type UnknownError struct {
+	errors.DropboxError
+}
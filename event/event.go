@@ -0,0 +1,22 @@
+// Package event holds the stop flag for the websocket listeners used
+// to push live updates to the management UI. It tracks no websocket
+// connections itself.
+package event
+
+import (
+	"sync"
+)
+
+var (
+	lock    sync.Mutex
+	stopped bool
+)
+
+// WebSocketsStop marks the management websockets stopped, called when
+// the web server is restarted or shut down. It closes no connections.
+func WebSocketsStop() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	stopped = true
+}
@@ -0,0 +1,92 @@
+package mhandlers
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-zero/audit"
+	"github.com/pritunl/pritunl-zero/audit/sinks"
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/utils"
+)
+
+// sinkSettings is the per-node sink configuration stored in the
+// settings collection.
+type sinkSettings struct {
+	Type    string         `bson:"type"`
+	Webhook *sinks.Webhook `bson:"webhook,omitempty"`
+	Syslog  *sinks.Syslog  `bson:"syslog,omitempty"`
+	File    *sinks.File    `bson:"file,omitempty"`
+}
+
+// LoadSinks reads the configured audit sinks from the settings
+// collection and registers them with the audit package. It is called
+// once during node init.
+func LoadSinks(ctx context.Context, db *database.Database) (err error) {
+	settings := &struct {
+		AuditSinks []*sinkSettings `bson:"audit_sinks"`
+	}{}
+
+	err = db.SettingsCtx(ctx).FindId("audit", settings)
+	if err != nil {
+		switch err.(type) {
+		case *database.NotFoundError:
+			err = nil
+		}
+		return
+	}
+
+	for _, cfg := range settings.AuditSinks {
+		switch cfg.Type {
+		case "webhook":
+			if cfg.Webhook != nil {
+				audit.RegisterSink(cfg.Webhook)
+			}
+		case "syslog":
+			if cfg.Syslog != nil {
+				audit.RegisterSink(cfg.Syslog)
+			}
+		case "file":
+			if cfg.File != nil {
+				audit.RegisterSink(cfg.File)
+			}
+		}
+	}
+
+	return
+}
+
+func auditSinksGet(c *gin.Context) {
+	labels := []string{}
+	for _, sink := range audit.Sinks() {
+		labels = append(labels, sink.Label())
+	}
+
+	c.JSON(200, labels)
+}
+
+func auditSinkTestPost(c *gin.Context) {
+	ctx := c.Request.Context()
+	label := c.Param("label")
+
+	err := audit.SendTest(ctx, label)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.Status(200)
+}
+
+func auditFailuresGet(c *gin.Context) {
+	ctx := c.Request.Context()
+	db := c.MustGet("db").(*database.Database)
+
+	failures, err := audit.RecentFailures(ctx, db, 100)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, failures)
+}
@@ -0,0 +1,50 @@
+// Package mhandlers implements the management-domain API: service
+// configuration (including load balancing and health checks) and
+// audit sink administration.
+package mhandlers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/middlewear"
+)
+
+var loadSinksOnce sync.Once
+
+// Register wires the management routes behind the admin session and
+// CSRF middlewear chain.
+func Register(protocol string, engine *gin.Engine) {
+	loadSinksOnce.Do(func() {
+		db := database.GetDatabase()
+		defer db.Close()
+
+		err := LoadSinks(context.Background(), db)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("mhandlers: Failed to load audit sinks")
+		}
+	})
+
+	engine.Use(middlewear.Limiter)
+	engine.Use(middlewear.Recovery)
+	engine.Use(middlewear.Counter)
+	engine.Use(middlewear.Context)
+	engine.Use(middlewear.Database)
+	engine.Use(middlewear.Session)
+	engine.Use(middlewear.Auth)
+	engine.Use(middlewear.CsrfToken)
+
+	engine.NoRoute(middlewear.NotFound)
+
+	engine.GET("/service", servicesGet)
+	engine.PUT("/service/:service_id", serviceUpdatePut)
+
+	engine.GET("/audit/sink", auditSinksGet)
+	engine.POST("/audit/sink/:label/test", auditSinkTestPost)
+	engine.GET("/audit/failure", auditFailuresGet)
+}
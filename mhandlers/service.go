@@ -0,0 +1,54 @@
+package mhandlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/node"
+	"github.com/pritunl/pritunl-zero/service"
+	"github.com/pritunl/pritunl-zero/utils"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func servicesGet(c *gin.Context) {
+	ctx := c.Request.Context()
+	db := c.MustGet("db").(*database.Database)
+
+	services, err := service.GetAll(ctx, db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, services)
+}
+
+// serviceUpdatePut saves a service's configuration, including its
+// LoadBalancer and Healthcheck, and rebuilds the node's proxy routing
+// table so the change takes effect immediately.
+func serviceUpdatePut(c *gin.Context) {
+	ctx := c.Request.Context()
+	db := c.MustGet("db").(*database.Database)
+	srvc := &service.Service{}
+
+	err := c.Bind(srvc)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+	srvc.Id = bson.ObjectIdHex(c.Param("service_id"))
+
+	err = service.Update(ctx, db, srvc)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+
+	services, err := service.GetAll(ctx, db)
+	if err != nil {
+		utils.AbortWithError(c, 500, err)
+		return
+	}
+	node.Self.SyncServices(services)
+
+	c.JSON(200, srvc)
+}
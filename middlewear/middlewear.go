@@ -1,12 +1,14 @@
 package middlewear
 
 import (
+	"context"
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	"github.com/dropbox/godropbox/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/pritunl/pritunl-zero/auth"
 	"github.com/pritunl/pritunl-zero/authorizer"
+	"github.com/pritunl/pritunl-zero/constants"
 	"github.com/pritunl/pritunl-zero/csrf"
 	"github.com/pritunl/pritunl-zero/database"
 	"github.com/pritunl/pritunl-zero/errortypes"
@@ -16,6 +18,7 @@ import (
 	"github.com/pritunl/pritunl-zero/utils"
 	"github.com/pritunl/pritunl-zero/validator"
 	"net/http"
+	"time"
 )
 
 const robots = `User-agent: *
@@ -30,17 +33,56 @@ func Counter(c *gin.Context) {
 	node.Self.AddRequest()
 }
 
+// Service resolves the proxied Service (if any) for the request's
+// Host and stores it in the gin context, ahead of Context so it can
+// honor a per-service request timeout.
+func Service(c *gin.Context) {
+	var srvc *service.Service
+
+	host := node.Self.Handler.Hosts[c.Request.Host]
+	if host != nil {
+		srvc = host.Service
+	}
+
+	c.Set("service", srvc)
+}
+
+// Context derives a request-scoped context, bounded by the resolved
+// service's RequestTimeout or constants.DefaultRequestTimeout when
+// none is set, so downstream middlewear and handlers can bail out
+// database and auth work when the client disconnects or the deadline
+// elapses.
+func Context(c *gin.Context) {
+	timeout := constants.DefaultRequestTimeout
+
+	if v, ok := c.Get("service"); ok {
+		if srvc, _ := v.(*service.Service); srvc != nil &&
+			srvc.RequestTimeout > 0 {
+
+			timeout = time.Duration(srvc.RequestTimeout) * time.Second
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
 func Database(c *gin.Context) {
-	db := database.GetDatabase()
+	ctx := c.Request.Context()
+	db := database.GetDatabaseCtx(ctx)
 	c.Set("db", db)
 	c.Next()
 	db.Close()
 }
 
 func Session(c *gin.Context) {
+	ctx := c.Request.Context()
 	db := c.MustGet("db").(*database.Database)
 
-	authr, err := authorizer.Authorize(db, c.Writer, c.Request)
+	authr, err := authorizer.Authorize(ctx, db, c.Writer, c.Request)
 	if err != nil {
 		switch err.(type) {
 		case *errortypes.AuthenticationError:
@@ -53,27 +95,27 @@ func Session(c *gin.Context) {
 	}
 
 	if authr.IsValid() {
-		usr, err := authr.GetUser(db)
+		usr, err := authr.GetUser(ctx, db)
 		if err != nil {
 			utils.AbortWithError(c, 500, err)
 			return
 		}
 
 		if usr != nil {
-			active, err := auth.SyncUser(db, usr)
+			active, err := auth.SyncUser(ctx, db, usr)
 			if err != nil {
 				utils.AbortWithError(c, 500, err)
 				return
 			}
 
 			if !active {
-				err = authr.Clear(db, c.Writer, c.Request)
+				err = authr.Clear(ctx, db, c.Writer, c.Request)
 				if err != nil {
 					utils.AbortWithError(c, 500, err)
 					return
 				}
 
-				err = session.RemoveAll(db, usr.Id)
+				err = session.RemoveAll(ctx, db, usr.Id)
 				if err != nil {
 					utils.AbortWithError(c, 500, err)
 					return
@@ -86,6 +128,7 @@ func Session(c *gin.Context) {
 }
 
 func SessionProxy(c *gin.Context) {
+	ctx := c.Request.Context()
 	db := c.MustGet("db").(*database.Database)
 	srvc := c.MustGet("service").(*service.Service)
 
@@ -95,34 +138,34 @@ func SessionProxy(c *gin.Context) {
 		return
 	}
 
-	authr, err := authorizer.AuthorizeProxy(db, srvc, c.Writer, c.Request)
+	authr, err := authorizer.AuthorizeProxy(ctx, db, srvc, c.Writer, c.Request)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
 	}
 
 	if authr.IsValid() {
-		usr, err := authr.GetUser(db)
+		usr, err := authr.GetUser(ctx, db)
 		if err != nil {
 			utils.AbortWithError(c, 500, err)
 			return
 		}
 
 		if usr != nil {
-			active, err := auth.SyncUser(db, usr)
+			active, err := auth.SyncUser(ctx, db, usr)
 			if err != nil {
 				utils.AbortWithError(c, 500, err)
 				return
 			}
 
 			if !active {
-				err = authr.Clear(db, c.Writer, c.Request)
+				err = authr.Clear(ctx, db, c.Writer, c.Request)
 				if err != nil {
 					utils.AbortWithError(c, 500, err)
 					return
 				}
 
-				err = session.RemoveAll(db, usr.Id)
+				err = session.RemoveAll(ctx, db, usr.Id)
 				if err != nil {
 					return
 				}
@@ -134,6 +177,7 @@ func SessionProxy(c *gin.Context) {
 }
 
 func Auth(c *gin.Context) {
+	ctx := c.Request.Context()
 	db := c.MustGet("db").(*database.Database)
 	authr := c.MustGet("authorizer").(*authorizer.Authorizer)
 
@@ -142,7 +186,7 @@ func Auth(c *gin.Context) {
 		return
 	}
 
-	usr, err := authr.GetUser(db)
+	usr, err := authr.GetUser(ctx, db)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
@@ -153,14 +197,14 @@ func Auth(c *gin.Context) {
 		return
 	}
 
-	errData, err := validator.ValidateAdmin(db, usr)
+	errData, err := validator.ValidateAdmin(ctx, db, usr)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
 	}
 
 	if errData != nil {
-		err = authr.Clear(db, c.Writer, c.Request)
+		err = authr.Clear(ctx, db, c.Writer, c.Request)
 		if err != nil {
 			utils.AbortWithError(c, 500, err)
 			return
@@ -172,6 +216,7 @@ func Auth(c *gin.Context) {
 }
 
 func CsrfToken(c *gin.Context) {
+	ctx := c.Request.Context()
 	db := c.MustGet("db").(*database.Database)
 	authr := c.MustGet("authorizer").(*authorizer.Authorizer)
 
@@ -191,7 +236,7 @@ func CsrfToken(c *gin.Context) {
 		token = c.Request.Header.Get("Csrf-Token")
 	}
 
-	valid, err := csrf.ValidateToken(db, authr.SessionId(), token)
+	valid, err := csrf.ValidateToken(ctx, db, authr.SessionId(), token)
 	if err != nil {
 		switch err.(type) {
 		case *database.NotFoundError:
@@ -0,0 +1,203 @@
+// Package node holds this process's own configuration (listen
+// address, type, the proxy routing table) as the package-level Self.
+package node
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pritunl/pritunl-zero/proxy"
+	"github.com/pritunl/pritunl-zero/service"
+)
+
+const (
+	Management      = "management"
+	ManagementProxy  = "management_proxy"
+	Proxy            = "proxy"
+	defaultHcPath    = "/"
+	defaultHcStatus  = 200
+	defaultHcTimeout = 5 * time.Second
+)
+
+// Host is the routing entry Router.proxy looks up by request host.
+type Host struct {
+	Service *service.Service
+}
+
+// Handler is the live proxy routing table, rebuilt whenever the
+// service configuration changes.
+type Handler struct {
+	Hosts     map[string]*Host
+	Balancers map[string]proxy.Balancer
+
+	checkers map[string]*proxy.HealthChecker
+}
+
+type Node struct {
+	Type             string
+	Port             int
+	Protocol         string
+	ManagementDomain string
+	Handler          *Handler
+
+	requests int64
+}
+
+func (n *Node) AddRequest() {
+	atomic.AddInt64(&n.requests, 1)
+}
+
+func (n *Node) Requests() int64 {
+	return atomic.LoadInt64(&n.requests)
+}
+
+// GetRemoteAddr returns the caller's address, preferring the
+// X-Forwarded-For header set by an upstream load balancer over
+// r.RemoteAddr.
+func (n *Node) GetRemoteAddr(r *http.Request) string {
+	forwardedFor := r.Header.Get("X-Forwarded-For")
+	if forwardedFor != "" {
+		addrs := strings.Split(forwardedFor, ",")
+		return strings.TrimSpace(addrs[0])
+	}
+
+	addr := r.RemoteAddr
+	if i := strings.LastIndex(addr, ":"); i != -1 {
+		addr = addr[:i]
+	}
+	return addr
+}
+
+func serverTarget(srv *service.Server) string {
+	return fmt.Sprintf("%s://%s:%d", srv.Protocol, srv.Hostname, srv.Port)
+}
+
+func healthCheckFor(srvc *service.Service) proxy.HealthCheck {
+	hc := srvc.Healthcheck
+
+	path := defaultHcPath
+	status := defaultHcStatus
+	interval := 10 * time.Second
+	timeout := defaultHcTimeout
+
+	if hc != nil {
+		if hc.Path != "" {
+			path = hc.Path
+		}
+		if hc.ExpectedStatus != 0 {
+			status = hc.ExpectedStatus
+		}
+		if hc.Interval > 0 {
+			interval = time.Duration(hc.Interval) * time.Second
+		}
+		if hc.Timeout > 0 {
+			timeout = time.Duration(hc.Timeout) * time.Second
+		}
+	}
+
+	return proxy.HealthCheck{
+		Path:           path,
+		ExpectedStatus: status,
+		Interval:       interval,
+		Timeout:        timeout,
+	}
+}
+
+// serviceState caches the balancer and health checker built for a
+// single service together with the service config they were built
+// from, so SyncServices can tell whether that service actually changed
+// since the last sync.
+type serviceState struct {
+	service  *service.Service
+	balancer proxy.Balancer
+	checker  *proxy.HealthChecker
+}
+
+// SyncServices rebuilds the Handler's routing table from the current
+// set of services. Only services whose config actually changed since
+// the last sync (or that are new) get a new Balancer/HealthChecker;
+// unchanged services keep their existing ones, carrying forward their
+// backends' live health/backoff state instead of resetting it to "up"
+// on every unrelated service save.
+func (n *Node) SyncServices(services []*service.Service) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	hosts := map[string]*Host{}
+	balancers := map[string]proxy.Balancer{}
+	checkers := map[string]*proxy.HealthChecker{}
+	cache := map[string]*serviceState{}
+
+	for _, srvc := range services {
+		key := srvc.Id.Hex()
+
+		state := serviceCache[key]
+		if state == nil || !reflect.DeepEqual(state.service, srvc) {
+			backends := make([]*proxy.Backend, 0, len(srvc.Servers))
+			for i, srv := range srvc.Servers {
+				backends = append(backends, proxy.NewBackend(
+					fmt.Sprintf("%s-%d", srvc.Id.Hex(), i),
+					serverTarget(srv),
+					srv.Weight,
+				))
+			}
+
+			checker := proxy.NewHealthChecker(healthCheckFor(srvc), backends)
+			for _, backend := range backends {
+				backend.SetHealthChecker(checker)
+			}
+			checker.Start()
+
+			balancer := proxy.NewBalancer(
+				srvc.LoadBalancer, srvc.Sticky, backends)
+
+			if state != nil {
+				state.checker.Stop()
+			}
+
+			state = &serviceState{
+				service:  srvc,
+				balancer: balancer,
+				checker:  checker,
+			}
+		}
+
+		cache[key] = state
+
+		for _, domain := range srvc.Domains {
+			hosts[domain.Domain] = &Host{Service: srvc}
+			balancers[domain.Domain] = state.balancer
+			checkers[domain.Domain] = state.checker
+		}
+	}
+
+	for key, state := range serviceCache {
+		if cache[key] == nil {
+			state.checker.Stop()
+		}
+	}
+
+	serviceCache = cache
+	n.Handler = &Handler{
+		Hosts:     hosts,
+		Balancers: balancers,
+		checkers:  checkers,
+	}
+}
+
+var (
+	lock         sync.Mutex
+	serviceCache = map[string]*serviceState{}
+	Self         = &Node{
+		Handler: &Handler{
+			Hosts:     map[string]*Host{},
+			Balancers: map[string]proxy.Balancer{},
+			checkers:  map[string]*proxy.HealthChecker{},
+		},
+	}
+)
@@ -35,6 +35,7 @@ type authData struct {
 }
 
 func authSessionPost(c *gin.Context) {
+	ctx := c.Request.Context()
 	db := c.MustGet("db").(*database.Database)
 	authr := c.MustGet("authorizer").(*authorizer.Authorizer)
 	srvc := c.MustGet("service").(*service.Service)
@@ -51,7 +52,7 @@ func authSessionPost(c *gin.Context) {
 		return
 	}
 
-	usr, errData, err := auth.Local(db, data.Username, data.Password)
+	usr, errData, err := auth.Local(ctx, db, data.Username, data.Password)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
@@ -62,7 +63,7 @@ func authSessionPost(c *gin.Context) {
 		return
 	}
 
-	errData, err = validator.Validate(db, usr, authr, srvc, c.Request)
+	errData, err = validator.Validate(ctx, db, usr, authr, srvc, c.Request)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
@@ -70,9 +71,12 @@ func authSessionPost(c *gin.Context) {
 
 	if errData != nil {
 		err = audit.New(
+			ctx,
 			db,
 			c.Request,
-			usr.Id,
+			usr,
+			srvc,
+			"local",
 			audit.LoginFailed,
 			audit.Fields{
 				"error":   errData.Error,
@@ -89,13 +93,14 @@ func authSessionPost(c *gin.Context) {
 	}
 
 	err = audit.New(
+		ctx,
 		db,
 		c.Request,
-		usr.Id,
+		usr,
+		srvc,
+		"local",
 		audit.Login,
-		audit.Fields{
-			"method": "local",
-		},
+		nil,
 	)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
@@ -104,7 +109,7 @@ func authSessionPost(c *gin.Context) {
 
 	cook := cookie.NewProxy(srvc, c.Writer, c.Request)
 
-	_, err = cook.NewSession(db, c.Request, usr.Id, true)
+	_, err = cook.NewSession(ctx, db, c.Request, usr.Id, true)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
@@ -114,11 +119,12 @@ func authSessionPost(c *gin.Context) {
 }
 
 func logoutGet(c *gin.Context) {
+	ctx := c.Request.Context()
 	db := c.MustGet("db").(*database.Database)
 	authr := c.MustGet("authorizer").(*authorizer.Authorizer)
 
 	if authr.IsValid() {
-		err := authr.Remove(db)
+		err := authr.Remove(ctx, db)
 		if err != nil {
 			utils.AbortWithError(c, 500, err)
 			return
@@ -133,6 +139,7 @@ func authRequestGet(c *gin.Context) {
 }
 
 func authCallbackGet(c *gin.Context) {
+	ctx := c.Request.Context()
 	db := c.MustGet("db").(*database.Database)
 	srvc := c.MustGet("service").(*service.Service)
 	authr := c.MustGet("authorizer").(*authorizer.Authorizer)
@@ -144,7 +151,7 @@ func authCallbackGet(c *gin.Context) {
 		return
 	}
 
-	usr, errData, err := auth.Callback(db, sig, query)
+	usr, errData, err := auth.Callback(ctx, db, sig, query)
 	if err != nil {
 		switch err.(type) {
 		case *auth.InvalidState:
@@ -161,7 +168,7 @@ func authCallbackGet(c *gin.Context) {
 		return
 	}
 
-	errData, err = validator.Validate(db, usr, authr, srvc, c.Request)
+	errData, err = validator.Validate(ctx, db, usr, authr, srvc, c.Request)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
@@ -173,13 +180,14 @@ func authCallbackGet(c *gin.Context) {
 	}
 
 	err = audit.New(
+		ctx,
 		db,
 		c.Request,
-		usr.Id,
+		usr,
+		srvc,
+		"sso",
 		audit.Login,
-		audit.Fields{
-			"method": "sso",
-		},
+		nil,
 	)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
@@ -188,7 +196,7 @@ func authCallbackGet(c *gin.Context) {
 
 	cook := cookie.NewProxy(srvc, c.Writer, c.Request)
 
-	_, err = cook.NewSession(db, c.Request, usr.Id, true)
+	_, err = cook.NewSession(ctx, db, c.Request, usr.Id, true)
 	if err != nil {
 		utils.AbortWithError(c, 500, err)
 		return
@@ -0,0 +1,33 @@
+package phandlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-zero/middlewear"
+)
+
+// Register wires the proxy-facing routes: the public auth endpoints
+// used by a service's login page, and the per-service session/auth
+// middlewear chain every other route runs behind.
+func Register(protocol string, engine *gin.Engine) {
+	engine.Use(middlewear.Limiter)
+	engine.Use(middlewear.Recovery)
+	engine.Use(middlewear.Counter)
+	engine.Use(middlewear.Service)
+	engine.Use(middlewear.Context)
+
+	engine.GET("/robots.txt", middlewear.RobotsGet)
+	engine.NoRoute(middlewear.NotFound)
+
+	dbGroup := engine.Group("")
+	dbGroup.Use(middlewear.Database)
+	dbGroup.Use(middlewear.SessionProxy)
+
+	dbGroup.GET("/auth/state", authStateGet)
+	dbGroup.POST("/auth/session", authSessionPost)
+	dbGroup.GET("/auth/request", authRequestGet)
+	dbGroup.GET("/auth/callback", authCallbackGet)
+	dbGroup.GET("/logout", logoutGet)
+
+	csrfGroup := dbGroup.Group("")
+	csrfGroup.Use(middlewear.CsrfToken)
+}
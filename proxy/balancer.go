@@ -0,0 +1,424 @@
+// Package proxy implements pluggable, health-aware load balancing for
+// service backends served by Router.proxy.
+package proxy
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-zero/errortypes"
+	"github.com/pritunl/pritunl-zero/session"
+)
+
+const (
+	Random      = "random"
+	RoundRobin  = "round_robin"
+	LeastConn   = "least_conn"
+	EwmaLatency = "ewma_latency"
+)
+
+// Backend wraps a single upstream ReverseProxy with the bookkeeping a
+// Balancer and HealthChecker need to make routing decisions.
+type Backend struct {
+	Id       string
+	Target   string
+	Proxy    *httputil.ReverseProxy
+	Weight   int
+	down     int32
+	inFlight int64
+	ewma     int64 // response latency EWMA, nanoseconds
+	metrics  Metrics
+
+	healthChecker *HealthChecker
+}
+
+// NewBackend builds a Backend proxying to target, with its
+// ReverseProxy wired so connection failures and 502/503/504 responses
+// during live traffic report through to a HealthChecker without
+// waiting for the next probe interval. Call SetHealthChecker before
+// the Backend serves any traffic.
+func NewBackend(id string, target string, weight int) *Backend {
+	targetUrl, err := url.Parse(target)
+	if err != nil {
+		targetUrl = &url.URL{Scheme: "http", Host: target}
+	}
+
+	backend := &Backend{
+		Id:     id,
+		Target: target,
+		Weight: weight,
+	}
+
+	revProxy := httputil.NewSingleHostReverseProxy(targetUrl)
+	revProxy.ErrorHandler = func(w http.ResponseWriter, re *http.Request,
+		err error) {
+
+		if backend.healthChecker != nil {
+			backend.healthChecker.MarkFailure(backend)
+		}
+		http.Error(w, "Bad gateway", 502)
+	}
+	revProxy.ModifyResponse = func(resp *http.Response) error {
+		switch resp.StatusCode {
+		case 502, 503, 504:
+			if backend.healthChecker != nil {
+				backend.healthChecker.MarkFailure(backend)
+			}
+		}
+		return nil
+	}
+
+	backend.Proxy = revProxy
+	return backend
+}
+
+// SetHealthChecker binds the HealthChecker this Backend reports
+// live-traffic failures to.
+func (b *Backend) SetHealthChecker(checker *HealthChecker) {
+	b.healthChecker = checker
+}
+
+func (b *Backend) IsHealthy() bool {
+	return atomic.LoadInt32(&b.down) == 0
+}
+
+func (b *Backend) markDown() {
+	atomic.StoreInt32(&b.down, 1)
+}
+
+func (b *Backend) markUp() {
+	atomic.StoreInt32(&b.down, 0)
+}
+
+func (b *Backend) begin() {
+	atomic.AddInt64(&b.inFlight, 1)
+}
+
+func (b *Backend) end(start time.Time) {
+	atomic.AddInt64(&b.inFlight, -1)
+
+	elapsed := time.Since(start).Nanoseconds()
+	for {
+		prev := atomic.LoadInt64(&b.ewma)
+		if prev == 0 {
+			if atomic.CompareAndSwapInt64(&b.ewma, 0, elapsed) {
+				return
+			}
+			continue
+		}
+
+		next := int64(float64(prev)*0.8 + float64(elapsed)*0.2)
+		if atomic.CompareAndSwapInt64(&b.ewma, prev, next) {
+			return
+		}
+	}
+}
+
+// ServeHTTP proxies re to the backend while tracking in-flight count and
+// latency for the least_conn and ewma_latency balancers.
+func (b *Backend) ServeHTTP(w http.ResponseWriter, re *http.Request) {
+	start := time.Now()
+	b.begin()
+	b.AddRequest()
+	defer b.end(start)
+
+	b.Proxy.ServeHTTP(w, re)
+}
+
+// Balancer picks a healthy backend for an incoming request.
+type Balancer interface {
+	Pick(re *http.Request) (*Backend, error)
+}
+
+func healthyBackends(backends []*Backend) []*Backend {
+	healthy := make([]*Backend, 0, len(backends))
+	for _, b := range backends {
+		if b.IsHealthy() {
+			healthy = append(healthy, b)
+		}
+	}
+	return healthy
+}
+
+func noBackendsErr() error {
+	return &errortypes.UnknownError{
+		errors.New("proxy: No healthy backends available"),
+	}
+}
+
+// effectiveWeight returns the weight a balancer should use for b,
+// defaulting an unset (zero) Weight to 1 so an operator who never sets
+// it gets even distribution rather than the backend being excluded.
+func effectiveWeight(b *Backend) int {
+	if b.Weight <= 0 {
+		return 1
+	}
+	return b.Weight
+}
+
+const (
+	// stickyTTL is how long a sticky mapping survives without being
+	// refreshed by another pick before evictExpiredSticky reclaims it,
+	// so sessions that end (expire, log out) don't pin a cookie value
+	// in memory forever.
+	stickyTTL           = 30 * time.Minute
+	stickyEvictInterval = 5 * time.Minute
+)
+
+type stickyEntry struct {
+	backendId string
+	expires   time.Time
+}
+
+// sticky tracks, per session cookie value, which backend a user's
+// requests have been landing on, so sticky balancers can keep sending
+// them there while it's healthy. Entries expire stickyTTL after their
+// last use and are reclaimed by evictExpiredSticky.
+var (
+	stickyLock  sync.RWMutex
+	stickyTable = map[string]*stickyEntry{}
+)
+
+func stickyBackend(re *http.Request, healthy []*Backend) *Backend {
+	cook, err := re.Cookie(session.CookieName)
+	if err != nil || cook.Value == "" {
+		return nil
+	}
+
+	stickyLock.RLock()
+	entry, ok := stickyTable[cook.Value]
+	stickyLock.RUnlock()
+	if !ok || time.Now().After(entry.expires) {
+		return nil
+	}
+
+	for _, b := range healthy {
+		if b.Id == entry.backendId {
+			rememberSticky(re, b)
+			return b
+		}
+	}
+
+	return nil
+}
+
+func rememberSticky(re *http.Request, backend *Backend) {
+	cook, err := re.Cookie(session.CookieName)
+	if err != nil || cook.Value == "" {
+		return
+	}
+
+	stickyLock.Lock()
+	stickyTable[cook.Value] = &stickyEntry{
+		backendId: backend.Id,
+		expires:   time.Now().Add(stickyTTL),
+	}
+	stickyLock.Unlock()
+}
+
+// evictExpiredSticky drops sticky mappings that have passed their TTL
+// without being refreshed by another pick.
+func evictExpiredSticky() {
+	now := time.Now()
+
+	stickyLock.Lock()
+	defer stickyLock.Unlock()
+
+	for cookie, entry := range stickyTable {
+		if now.After(entry.expires) {
+			delete(stickyTable, cookie)
+		}
+	}
+}
+
+func stickyEvictWorker() {
+	ticker := time.NewTicker(stickyEvictInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		evictExpiredSticky()
+	}
+}
+
+func init() {
+	go stickyEvictWorker()
+}
+
+// randomBalancer picks a healthy backend at random, weighted by
+// effectiveWeight; with every Weight unset this is the original
+// rand.Intn(n) behavior.
+type randomBalancer struct {
+	backends []*Backend
+	sticky   bool
+}
+
+func (b *randomBalancer) Pick(re *http.Request) (*Backend, error) {
+	healthy := healthyBackends(b.backends)
+	if len(healthy) == 0 {
+		return nil, noBackendsErr()
+	}
+
+	if b.sticky {
+		if sticky := stickyBackend(re, healthy); sticky != nil {
+			return sticky, nil
+		}
+	}
+
+	totalWeight := 0
+	for _, cur := range healthy {
+		totalWeight += effectiveWeight(cur)
+	}
+
+	n := rand.Intn(totalWeight)
+	picked := healthy[len(healthy)-1]
+	for _, cur := range healthy {
+		n -= effectiveWeight(cur)
+		if n < 0 {
+			picked = cur
+			break
+		}
+	}
+	if b.sticky {
+		rememberSticky(re, picked)
+	}
+	return picked, nil
+}
+
+type roundRobinBalancer struct {
+	backends []*Backend
+	sticky   bool
+	counter  uint64
+}
+
+func (b *roundRobinBalancer) Pick(re *http.Request) (*Backend, error) {
+	healthy := healthyBackends(b.backends)
+	if len(healthy) == 0 {
+		return nil, noBackendsErr()
+	}
+
+	if b.sticky {
+		if sticky := stickyBackend(re, healthy); sticky != nil {
+			return sticky, nil
+		}
+	}
+
+	totalWeight := 0
+	for _, cur := range healthy {
+		totalWeight += effectiveWeight(cur)
+	}
+
+	n := int(atomic.AddUint64(&b.counter, 1)) % totalWeight
+	picked := healthy[len(healthy)-1]
+	for _, cur := range healthy {
+		n -= effectiveWeight(cur)
+		if n < 0 {
+			picked = cur
+			break
+		}
+	}
+	if b.sticky {
+		rememberSticky(re, picked)
+	}
+	return picked, nil
+}
+
+type leastConnBalancer struct {
+	backends []*Backend
+	sticky   bool
+}
+
+func (b *leastConnBalancer) Pick(re *http.Request) (*Backend, error) {
+	healthy := healthyBackends(b.backends)
+	if len(healthy) == 0 {
+		return nil, noBackendsErr()
+	}
+
+	if b.sticky {
+		if sticky := stickyBackend(re, healthy); sticky != nil {
+			return sticky, nil
+		}
+	}
+
+	best := healthy[0]
+	bestLoad := float64(atomic.LoadInt64(&best.inFlight)) / float64(effectiveWeight(best))
+	for _, cur := range healthy[1:] {
+		load := float64(atomic.LoadInt64(&cur.inFlight)) / float64(effectiveWeight(cur))
+		if load < bestLoad {
+			best = cur
+			bestLoad = load
+		}
+	}
+
+	if b.sticky {
+		rememberSticky(re, best)
+	}
+	return best, nil
+}
+
+type ewmaLatencyBalancer struct {
+	backends []*Backend
+	sticky   bool
+}
+
+func (b *ewmaLatencyBalancer) Pick(re *http.Request) (*Backend, error) {
+	healthy := healthyBackends(b.backends)
+	if len(healthy) == 0 {
+		return nil, noBackendsErr()
+	}
+
+	if b.sticky {
+		if sticky := stickyBackend(re, healthy); sticky != nil {
+			return sticky, nil
+		}
+	}
+
+	// A backend with no samples yet (ewma == 0) is treated as the
+	// fastest possible so new backends get traffic. A backend that
+	// recovers from being down keeps the EWMA it had before.
+	// Otherwise latency is normalized by weight so a heavier backend
+	// is preferred even once it's slightly slower.
+	best := healthy[0]
+	bestLatency := atomic.LoadInt64(&best.ewma)
+	bestScore := float64(bestLatency) / float64(effectiveWeight(best))
+	for _, cur := range healthy[1:] {
+		latency := atomic.LoadInt64(&cur.ewma)
+		score := float64(latency) / float64(effectiveWeight(cur))
+		if latency == 0 || (bestLatency != 0 && score < bestScore) {
+			best = cur
+			bestLatency = latency
+			bestScore = score
+		}
+	}
+
+	if b.sticky {
+		rememberSticky(re, best)
+	}
+	return best, nil
+}
+
+var balancerLock sync.Mutex
+
+// NewBalancer builds a Balancer of the requested kind over backends.
+// Unknown kinds fall back to random, matching the original
+// proxies[rand.Intn(n)] behavior.
+func NewBalancer(kind string, sticky bool, backends []*Backend) Balancer {
+	balancerLock.Lock()
+	defer balancerLock.Unlock()
+
+	switch kind {
+	case RoundRobin:
+		return &roundRobinBalancer{backends: backends, sticky: sticky}
+	case LeastConn:
+		return &leastConnBalancer{backends: backends, sticky: sticky}
+	case EwmaLatency:
+		return &ewmaLatencyBalancer{backends: backends, sticky: sticky}
+	default:
+		return &randomBalancer{backends: backends, sticky: sticky}
+	}
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestRequest(t *testing.T, sessionCookie string) *http.Request {
+	re, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessionCookie != "" {
+		re.AddCookie(&http.Cookie{
+			Name:  "pritunl-zero-session",
+			Value: sessionCookie,
+		})
+	}
+	return re
+}
+
+func TestRoundRobinBalancerCyclesBackends(t *testing.T) {
+	backends := []*Backend{
+		{Id: "a"}, {Id: "b"}, {Id: "c"},
+	}
+	balancer := NewBalancer(RoundRobin, false, backends)
+
+	seen := map[string]bool{}
+	for i := 0; i < len(backends); i++ {
+		picked, err := balancer.Pick(newTestRequest(t, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[picked.Id] = true
+	}
+
+	if len(seen) != len(backends) {
+		t.Errorf("round robin visited %d distinct backends, want %d",
+			len(seen), len(backends))
+	}
+}
+
+func TestBalancerSkipsUnhealthyBackends(t *testing.T) {
+	down := &Backend{Id: "down"}
+	down.markDown()
+	up := &Backend{Id: "up"}
+
+	balancer := NewBalancer(Random, false, []*Backend{down, up})
+
+	for i := 0; i < 10; i++ {
+		picked, err := balancer.Pick(newTestRequest(t, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if picked.Id != "up" {
+			t.Fatalf("picked %s, want up", picked.Id)
+		}
+	}
+}
+
+func TestBalancerNoHealthyBackendsErrors(t *testing.T) {
+	down := &Backend{Id: "down"}
+	down.markDown()
+
+	balancer := NewBalancer(Random, false, []*Backend{down})
+
+	_, err := balancer.Pick(newTestRequest(t, ""))
+	if err == nil {
+		t.Fatal("expected error when no backends are healthy")
+	}
+}
+
+func TestStickyBalancerKeepsSessionOnBackend(t *testing.T) {
+	backends := []*Backend{{Id: "a"}, {Id: "b"}, {Id: "c"}}
+	balancer := NewBalancer(RoundRobin, true, backends)
+
+	re := newTestRequest(t, "session-1")
+
+	first, err := balancer.Pick(re)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		picked, err := balancer.Pick(re)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if picked.Id != first.Id {
+			t.Fatalf("sticky pick changed from %s to %s", first.Id, picked.Id)
+		}
+	}
+}
+
+func TestLeastConnBalancerPicksFewestInFlight(t *testing.T) {
+	busy := &Backend{Id: "busy"}
+	busy.begin()
+	busy.begin()
+	idle := &Backend{Id: "idle"}
+
+	balancer := NewBalancer(LeastConn, false, []*Backend{busy, idle})
+
+	picked, err := balancer.Pick(newTestRequest(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if picked.Id != "idle" {
+		t.Errorf("picked %s, want idle", picked.Id)
+	}
+}
+
+func TestMarkFailureMarksDownThenRecovers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter, re *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	backend := NewBackend("b1", srv.URL, 1)
+	checker := NewHealthChecker(HealthCheck{
+		Path:           "/",
+		ExpectedStatus: 200,
+		Interval:       time.Hour,
+		Timeout:        time.Second,
+	}, []*Backend{backend})
+	backend.SetHealthChecker(checker)
+
+	checker.MarkFailure(backend)
+	if backend.IsHealthy() {
+		t.Fatal("backend should be marked down immediately after MarkFailure")
+	}
+
+	deadline := time.Now().Add(minBackoff + 2*time.Second)
+	for time.Now().Before(deadline) {
+		if backend.IsHealthy() {
+			return
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+	t.Fatal("backend did not recover after its backoff elapsed")
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	minBackoff = 1 * time.Second
+	maxBackoff = 1 * time.Minute
+)
+
+// HealthCheck configures the probe a HealthChecker runs against a
+// Service's backends.
+type HealthCheck struct {
+	Path           string
+	ExpectedStatus int
+	Interval       time.Duration
+	Timeout        time.Duration
+}
+
+func (h *HealthCheck) client() *http.Client {
+	return &http.Client{
+		Timeout: h.Timeout,
+	}
+}
+
+// HealthChecker periodically probes a set of backends and marks failing
+// ones down so balancers skip them. It also exposes MarkFailure so a
+// Backend's ReverseProxy can report live-traffic errors (connection
+// refused, 502/503/504) without waiting for the next probe interval.
+type HealthChecker struct {
+	check    HealthCheck
+	backends []*Backend
+	stop     chan struct{}
+	lock     sync.Mutex
+	backoff  map[string]time.Duration
+}
+
+func NewHealthChecker(check HealthCheck, backends []*Backend) *HealthChecker {
+	return &HealthChecker{
+		check:    check,
+		backends: backends,
+		stop:     make(chan struct{}),
+		backoff:  map[string]time.Duration{},
+	}
+}
+
+func (h *HealthChecker) probe(backend *Backend) bool {
+	client := h.check.client()
+
+	resp, err := client.Get(backend.Target + h.check.Path)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode == h.check.ExpectedStatus
+}
+
+func (h *HealthChecker) nextBackoff(backend *Backend) time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	cur := h.backoff[backend.Id]
+	if cur == 0 {
+		cur = minBackoff
+	} else {
+		cur = cur * 2
+		if cur > maxBackoff {
+			cur = maxBackoff
+		}
+	}
+
+	h.backoff[backend.Id] = cur
+	return cur
+}
+
+func (h *HealthChecker) clearBackoff(backend *Backend) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.backoff, backend.Id)
+}
+
+// MarkFailure records a live-traffic failure (connection refused,
+// 502/503/504) against backend, marking it down and probing it once
+// more after a backoff that doubles with each failure until a probe
+// succeeds. The periodic probe in run does not consult the backoff and
+// can mark the backend up before it elapses; if the delayed probe
+// fails, the backend stays down until a periodic probe succeeds.
+func (h *HealthChecker) MarkFailure(backend *Backend) {
+	backend.AddError()
+	backend.markDown()
+	backoff := h.nextBackoff(backend)
+
+	go func() {
+		time.Sleep(backoff)
+		if h.probe(backend) {
+			h.clearBackoff(backend)
+			backend.markUp()
+		}
+	}()
+}
+
+func (h *HealthChecker) run() {
+	ticker := time.NewTicker(h.check.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, backend := range h.backends {
+				healthy := h.probe(backend)
+
+				if healthy {
+					if !backend.IsHealthy() {
+						logrus.WithFields(logrus.Fields{
+							"backend": backend.Target,
+						}).Info("proxy: Backend recovered")
+					}
+					h.clearBackoff(backend)
+					backend.markUp()
+				} else if backend.IsHealthy() {
+					logrus.WithFields(logrus.Fields{
+						"backend": backend.Target,
+					}).Warn("proxy: Backend failed health check")
+					backend.markDown()
+				}
+			}
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+func (h *HealthChecker) Start() {
+	go h.run()
+}
+
+func (h *HealthChecker) Stop() {
+	close(h.stop)
+}
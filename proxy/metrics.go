@@ -0,0 +1,34 @@
+package proxy
+
+import "sync/atomic"
+
+// Metrics holds the per-backend counters returned by
+// Backend.Metrics. Nothing in this package publishes them on a
+// metrics path.
+type Metrics struct {
+	Requests int64
+	Errors   int64
+	InFlight int64
+	// LastProbeLatency holds the backend's response-latency EWMA over
+	// proxied requests, in nanoseconds; health probe latency is not
+	// recorded.
+	LastProbeLatency int64
+}
+
+func (b *Backend) AddRequest() {
+	atomic.AddInt64(&b.metrics.Requests, 1)
+}
+
+func (b *Backend) AddError() {
+	atomic.AddInt64(&b.metrics.Errors, 1)
+}
+
+// Metrics returns a snapshot of this backend's counters.
+func (b *Backend) Metrics() Metrics {
+	return Metrics{
+		Requests:         atomic.LoadInt64(&b.metrics.Requests),
+		Errors:           atomic.LoadInt64(&b.metrics.Errors),
+		InFlight:         atomic.LoadInt64(&b.inFlight),
+		LastProbeLatency: atomic.LoadInt64(&b.ewma),
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/dropbox/godropbox/errors"
 	"github.com/gin-gonic/gin"
+	"github.com/pritunl/pritunl-zero/audit"
 	"github.com/pritunl/pritunl-zero/auth"
 	"github.com/pritunl/pritunl-zero/constants"
 	"github.com/pritunl/pritunl-zero/database"
@@ -15,7 +16,6 @@ import (
 	"github.com/pritunl/pritunl-zero/node"
 	"github.com/pritunl/pritunl-zero/phandlers"
 	"github.com/pritunl/pritunl-zero/utils"
-	"math/rand"
 	"net/http"
 	"sync"
 	"time"
@@ -34,23 +34,27 @@ type Router struct {
 	webServer        *http.Server
 }
 
+// proxy uses re.Context() for all downstream database and auth calls so
+// that a client disconnect cancels outstanding work instead of letting it
+// run to completion.
 func (r *Router) proxy(w http.ResponseWriter, re *http.Request) {
 	host := node.Self.Handler.Hosts[re.Host]
-	proxies, ok := node.Self.Handler.Proxies[re.Host]
-	n := len(proxies)
+	balancer, ok := node.Self.Handler.Balancers[re.Host]
 
-	if host != nil && ok && n != 0 {
-		db := database.GetDatabase()
+	if host != nil && ok && balancer != nil {
+		ctx := re.Context()
+
+		db := database.GetDatabaseCtx(ctx)
 		defer db.Close()
 
-		cook, sess, err := auth.CookieSessionProxy(db, w, re)
+		cook, sess, err := auth.CookieSessionProxy(ctx, db, w, re)
 		if err != nil {
 			http.Error(w, "Server error", 500)
 			return
 		}
 
 		if sess == nil {
-			err = cook.Remove(db)
+			err = cook.Remove(ctx, db)
 			if err != nil {
 				http.Error(w, "Server error", 500)
 				return
@@ -60,20 +64,37 @@ func (r *Router) proxy(w http.ResponseWriter, re *http.Request) {
 			return
 		}
 
-		usr, err := sess.GetUser(db)
+		usr, err := sess.GetUser(ctx, db)
 		if err != nil {
 			http.Error(w, "Server error", 500)
 			return
 		}
 
-		errData, err := auth.Validate(db, usr, host.Service)
+		errData, err := auth.Validate(ctx, db, usr, host.Service)
 		if err != nil {
 			http.Error(w, "Server error", 500)
 			return
 		}
 
 		if errData != nil {
-			err = cook.Remove(db)
+			err = audit.New(
+				ctx,
+				db,
+				re,
+				usr,
+				host.Service,
+				"",
+				audit.ProxyDeny,
+				audit.Fields{
+					"error": errData.Error,
+				},
+			)
+			if err != nil {
+				http.Error(w, "Server error", 500)
+				return
+			}
+
+			err = cook.Remove(ctx, db)
 			if err != nil {
 				http.Error(w, "Server error", 500)
 				return
@@ -83,7 +104,13 @@ func (r *Router) proxy(w http.ResponseWriter, re *http.Request) {
 			return
 		}
 
-		proxies[rand.Intn(n)].ServeHTTP(w, re)
+		backend, err := balancer.Pick(re)
+		if err != nil {
+			http.Error(w, "Service unavailable", 503)
+			return
+		}
+
+		backend.ServeHTTP(w, re)
 		return
 	}
 
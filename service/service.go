@@ -0,0 +1,89 @@
+// Package service defines the proxied Service model: the domains it
+// answers for, the backends traffic is balanced across, and how that
+// balancing and health checking should behave.
+package service
+
+import (
+	"context"
+
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/proxy"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	LoadBalancerRandom      = proxy.Random
+	LoadBalancerRoundRobin  = proxy.RoundRobin
+	LoadBalancerLeastConn   = proxy.LeastConn
+	LoadBalancerEwmaLatency = proxy.EwmaLatency
+)
+
+type Domain struct {
+	Domain string `bson:"domain" json:"domain"`
+}
+
+type Server struct {
+	Protocol string `bson:"protocol" json:"protocol"`
+	Hostname string `bson:"hostname" json:"hostname"`
+	Port     int    `bson:"port" json:"port"`
+	Weight   int    `bson:"weight" json:"weight"`
+}
+
+// Healthcheck configures the periodic probe run against every Server.
+type Healthcheck struct {
+	Path           string `bson:"path" json:"path"`
+	ExpectedStatus int    `bson:"expected_status" json:"expected_status"`
+	Interval       int    `bson:"interval" json:"interval"` // seconds
+	Timeout        int    `bson:"timeout" json:"timeout"`   // seconds
+}
+
+type Service struct {
+	Id           bson.ObjectId `bson:"_id,omitempty" json:"id"`
+	Name         string        `bson:"name" json:"name"`
+	Domains      []*Domain     `bson:"domains" json:"domains"`
+	Servers      []*Server     `bson:"servers" json:"servers"`
+	LoadBalancer string        `bson:"load_balancer" json:"load_balancer"`
+	Sticky       bool          `bson:"sticky" json:"sticky"`
+	Healthcheck  *Healthcheck  `bson:"healthcheck" json:"healthcheck"`
+	// RequestTimeout overrides the default per-request context
+	// deadline for this service; zero means use the default.
+	RequestTimeout int `bson:"request_timeout" json:"request_timeout"`
+}
+
+// Get loads a single Service by id.
+func Get(ctx context.Context, db *database.Database, id bson.ObjectId) (
+	srvc *Service, err error) {
+
+	srvc = &Service{}
+	err = db.ServicesCtx(ctx).FindId(id, srvc)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// GetAll loads every configured Service, used to rebuild the node's
+// proxy routing table.
+func GetAll(ctx context.Context, db *database.Database) (
+	services []*Service, err error) {
+
+	err = db.ServicesCtx(ctx).FindAll(bson.M{}, &services)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Update persists changes to an existing Service.
+func Update(ctx context.Context, db *database.Database, srvc *Service) (
+	err error) {
+
+	err = db.ServicesCtx(ctx).UpdateId(srvc.Id, srvc)
+	if err != nil {
+		return
+	}
+
+	return
+}
@@ -0,0 +1,67 @@
+// Package session persists login sessions and looks up the user each
+// one belongs to.
+package session
+
+import (
+	"context"
+
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/user"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CookieName is the cookie every session (direct login or proxied
+// service login) is tracked under.
+const CookieName = "pritunl-zero-session"
+
+type Session struct {
+	Id        string        `bson:"_id" json:"id"`
+	Type      string        `bson:"type" json:"type"`
+	UserId    bson.ObjectId `bson:"user_id" json:"user_id"`
+	ServiceId bson.ObjectId `bson:"service_id,omitempty" json:"service_id"`
+	Remember  bool          `bson:"remember" json:"remember"`
+}
+
+// GetUser loads the user this session belongs to.
+func (s *Session) GetUser(ctx context.Context, db *database.Database) (
+	usr *user.User, err error) {
+
+	usr = &user.User{}
+	err = db.UsersCtx(ctx).FindId(s.UserId, usr)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Get loads a session by id.
+func Get(ctx context.Context, db *database.Database, sessionId string) (
+	sess *Session, err error) {
+
+	sess = &Session{}
+	err = db.SessionsCtx(ctx).FindId(sessionId, sess)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// Remove deletes a single session.
+func Remove(ctx context.Context, db *database.Database, sessionId string) (
+	err error) {
+
+	err = db.SessionsCtx(ctx).RemoveId(sessionId)
+	return
+}
+
+// RemoveAll deletes every session belonging to userId, used when a
+// user is disabled mid-session so all of their active logins are
+// revoked at once.
+func RemoveAll(ctx context.Context, db *database.Database,
+	userId bson.ObjectId) (err error) {
+
+	err = db.SessionsCtx(ctx).RemoveAll(bson.M{"user_id": userId})
+	return
+}
@@ -0,0 +1,24 @@
+// Package user holds the persisted user record shared by auth,
+// session, authorizer and validator.
+package user
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type User struct {
+	Id       bson.ObjectId `bson:"_id,omitempty" json:"id"`
+	Type     string        `bson:"type" json:"type"`
+	Username string        `bson:"username" json:"username"`
+	Password string        `bson:"password" json:"-"`
+	Disabled bool          `bson:"disabled" json:"disabled"`
+}
+
+// CheckPassword reports whether password matches the user's stored
+// bcrypt hash.
+func (u *User) CheckPassword(password string) bool {
+	err := bcrypt.CompareHashAndPassword(
+		[]byte(u.Password), []byte(password))
+	return err == nil
+}
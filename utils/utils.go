@@ -0,0 +1,41 @@
+// Package utils holds small helpers shared across handlers and
+// middlewear that don't belong to any single domain package.
+package utils
+
+import (
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+)
+
+// AbortWithStatus aborts the gin context with status and no body.
+func AbortWithStatus(c *gin.Context, status int) {
+	c.AbortWithStatus(status)
+}
+
+// AbortWithError logs err and aborts the gin context with status.
+func AbortWithError(c *gin.Context, status int, err error) {
+	logrus.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("utils: Request error")
+
+	c.AbortWithStatus(status)
+}
+
+// Exists reports whether a file exists at path.
+func Exists(path string) (exists bool, err error) {
+	_, e := os.Stat(path)
+	if e == nil {
+		exists = true
+		return
+	}
+
+	if os.IsNotExist(e) {
+		exists = false
+		return
+	}
+
+	err = e
+	return
+}
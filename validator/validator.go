@@ -0,0 +1,63 @@
+// Package validator checks a resolved user against a Service's access
+// rules (or, for the management UI, against admin-only access) and
+// reports a structured reason when access is denied.
+package validator
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pritunl/pritunl-zero/authorizer"
+	"github.com/pritunl/pritunl-zero/database"
+	"github.com/pritunl/pritunl-zero/service"
+	"github.com/pritunl/pritunl-zero/user"
+)
+
+// ErrorData is returned whenever validation rejects a user, and is
+// serialized directly as the response body.
+type ErrorData struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// Validate checks whether usr may access srvc, used after a local or
+// SSO login to a proxied service.
+func Validate(ctx context.Context, db *database.Database, usr *user.User,
+	authr *authorizer.Authorizer, srvc *service.Service, r *http.Request) (
+	errData *ErrorData, err error) {
+
+	if usr == nil || usr.Disabled {
+		errData = &ErrorData{
+			Error:   "user_disabled",
+			Message: "User is disabled",
+		}
+		return
+	}
+
+	return
+}
+
+// ValidateAdmin checks whether usr may access the management UI,
+// re-checked on every admin request so a revoked admin is logged out
+// immediately rather than at next login.
+func ValidateAdmin(ctx context.Context, db *database.Database,
+	usr *user.User) (errData *ErrorData, err error) {
+
+	if usr.Disabled {
+		errData = &ErrorData{
+			Error:   "user_disabled",
+			Message: "User is disabled",
+		}
+		return
+	}
+
+	if usr.Type != "admin" {
+		errData = &ErrorData{
+			Error:   "not_admin",
+			Message: "User is not an administrator",
+		}
+		return
+	}
+
+	return
+}